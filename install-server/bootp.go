@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/kakwa/sun-v100-case/pkg/mapping"
+	"golang.org/x/sys/unix"
+)
+
+// Minimal BOOTP (RFC 951) packet layout, large enough to also speak plain
+// DHCPv4 (RFC 2131) since a DHCPDISCOVER/REQUEST is wire-compatible with a
+// BOOTREQUEST plus an options area. We don't implement the full DHCP state
+// machine (no leases, no lease negotiation) - every MAC has exactly one
+// fixed binding, so a DISCOVER always gets offered that binding and a
+// REQUEST for it is always ACKed. That is all a diskless Sun client doing
+// RARP+BOOTP or a dnsmasq-less netboot setup needs.
+const (
+	bootpOpRequest  = 1
+	bootpOpReply    = 2
+	bootpHTypeEth   = 1
+	bootpHLenEth    = 6
+	bootpPort       = 67
+	bootpClientPort = 68
+
+	dhcpMagicCookie = 0x63825363
+
+	optSubnetMask  = 1
+	optGateway     = 3
+	optRootPath    = 17
+	optMessageType = 53
+	optLeaseTime   = 51
+	optServerID    = 54
+	optEnd         = 255
+
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpAck      = 5
+)
+
+// defaultNetmask is stamped into DHCP option 1 when a Source doesn't carry
+// one of its own; RFC 2131 Table 3 marks the subnet mask MUST in both
+// OFFER and ACK, so it is always sent rather than only when boot.Netmask
+// is set.
+var defaultNetmask = [4]byte{255, 255, 255, 0}
+
+// bootpPacket mirrors the fixed-size BOOTP header (RFC 951 section 3);
+// the variable-length "vend" options area is handled separately since its
+// size varies between plain BOOTP (64 bytes) and DHCP (often larger).
+type bootpPacket struct {
+	Op      byte
+	HType   byte
+	HLen    byte
+	Hops    byte
+	XID     uint32
+	Secs    uint16
+	Flags   uint16
+	CIAddr  [4]byte
+	YIAddr  [4]byte
+	SIAddr  [4]byte
+	GIAddr  [4]byte
+	CHAddr  [16]byte
+	SName   [64]byte
+	File    [128]byte
+}
+
+const bootpFixedLen = 1 + 1 + 1 + 1 + 4 + 2 + 2 + 4 + 4 + 4 + 4 + 16 + 64 + 128 // 236
+
+func parseBootpRequest(b []byte) (bootpPacket, []byte, error) {
+	var p bootpPacket
+	if len(b) < bootpFixedLen {
+		return p, nil, fmt.Errorf("bootp packet too short: %d", len(b))
+	}
+	o := 0
+	p.Op = b[o]; o++
+	p.HType = b[o]; o++
+	p.HLen = b[o]; o++
+	p.Hops = b[o]; o++
+	p.XID = binary.BigEndian.Uint32(b[o : o+4]); o += 4
+	p.Secs = binary.BigEndian.Uint16(b[o : o+2]); o += 2
+	p.Flags = binary.BigEndian.Uint16(b[o : o+2]); o += 2
+	copy(p.CIAddr[:], b[o:o+4]); o += 4
+	copy(p.YIAddr[:], b[o:o+4]); o += 4
+	copy(p.SIAddr[:], b[o:o+4]); o += 4
+	copy(p.GIAddr[:], b[o:o+4]); o += 4
+	copy(p.CHAddr[:], b[o:o+16]); o += 16
+	copy(p.SName[:], b[o:o+64]); o += 64
+	copy(p.File[:], b[o:o+128]); o += 128
+	if p.Op != bootpOpRequest {
+		return p, nil, fmt.Errorf("not a BOOTREQUEST: op=%d", p.Op)
+	}
+	return p, b[o:], nil
+}
+
+// dhcpOption scans a BOOTP vend/options area (past the magic cookie) for
+// code, returning its value. A pure BOOTP request has no options area at
+// all, or one without the cookie, in which case ok is false.
+func dhcpOption(opts []byte, code byte) (val []byte, ok bool) {
+	if len(opts) < 4 || binary.BigEndian.Uint32(opts[:4]) != dhcpMagicCookie {
+		return nil, false
+	}
+	o := 4
+	for o < len(opts) {
+		tag := opts[o]
+		if tag == optEnd {
+			break
+		}
+		if tag == 0 { // pad
+			o++
+			continue
+		}
+		if o+1 >= len(opts) {
+			break
+		}
+		l := int(opts[o+1])
+		if o+2+l > len(opts) {
+			break
+		}
+		if tag == code {
+			return opts[o+2 : o+2+l], true
+		}
+		o += 2 + l
+	}
+	return nil, false
+}
+
+// dhcpReplyType maps the DHCP message type (option 53) the client sent to
+// the one we should reply with: a DISCOVER gets an OFFER, a REQUEST (or
+// anything else bearing option 53) gets an ACK. ok is false for a plain
+// BOOTP request carrying no option 53 at all, in which case the reply
+// omits the DHCP options and is pure BOOTP.
+func dhcpReplyType(opts []byte) (reply byte, ok bool) {
+	mtype, present := dhcpOption(opts, optMessageType)
+	if !present || len(mtype) != 1 {
+		return 0, false
+	}
+	if mtype[0] == dhcpDiscover {
+		return dhcpOffer, true
+	}
+	return dhcpAck, true
+}
+
+// buildBootpReply builds a BOOTREPLY for req, filling yiaddr/siaddr/file
+// from ip/boot and appending the rootpath/gateway DHCP options when set. It always stamps the DHCP magic cookie so DHCP clients accept
+// the options area; a pure BOOTP client simply ignores it. When reqOpts
+// carries a DHCP message type (option 53), the reply also carries option
+// 53 (DHCPOFFER for a DISCOVER, DHCPACK otherwise), option 54 (server
+// identifier) and option 51 (lease time, leaseSeconds) - RFC 2131 Table 3
+// marks all three MUST, and a real DHCP client discards a reply missing
+// any of them. Option 1 (subnet mask) is likewise always sent, falling
+// back to defaultNetmask when boot carries none.
+func buildBootpReply(serverIP net.IP, req bootpPacket, reqOpts []byte, ip [4]byte, boot mapping.BootInfo, leaseSeconds uint32) []byte {
+	buf := make([]byte, bootpFixedLen, bootpFixedLen+64)
+	o := 0
+	buf[o] = bootpOpReply; o++
+	buf[o] = req.HType; o++
+	buf[o] = req.HLen; o++
+	buf[o] = 0; o++ // hops
+	binary.BigEndian.PutUint32(buf[o:o+4], req.XID); o += 4
+	binary.BigEndian.PutUint16(buf[o:o+2], 0); o += 2 // secs
+	binary.BigEndian.PutUint16(buf[o:o+2], req.Flags); o += 2
+	o += 4 // ciaddr left zero
+
+	copy(buf[o:o+4], ip[:]); o += 4 // yiaddr
+
+	siaddr := boot.NextServer
+	if siaddr == ([4]byte{}) {
+		copy(siaddr[:], serverIP.To4())
+	}
+	copy(buf[o:o+4], siaddr[:]); o += 4
+
+	o += 4 // giaddr left zero
+	copy(buf[o:o+16], req.CHAddr[:]); o += 16
+	o += 64 // sname left zero
+	if boot.Bootfile != "" {
+		copy(buf[o:o+128], []byte(boot.Bootfile))
+	}
+	o += 128
+
+	var opts [4]byte
+	binary.BigEndian.PutUint32(opts[:], dhcpMagicCookie)
+	buf = append(buf, opts[:]...)
+
+	if replyType, ok := dhcpReplyType(reqOpts); ok {
+		buf = append(buf, optMessageType, 1, replyType)
+		buf = append(buf, optServerID, 4)
+		buf = append(buf, serverIP.To4()...)
+		var lt [4]byte
+		binary.BigEndian.PutUint32(lt[:], leaseSeconds)
+		buf = append(buf, optLeaseTime, 4)
+		buf = append(buf, lt[:]...)
+	}
+	netmask := defaultNetmask
+	if boot.Netmask != ([4]byte{}) {
+		netmask = boot.Netmask
+	}
+	buf = append(buf, optSubnetMask, 4)
+	buf = append(buf, netmask[:]...)
+	if boot.Gateway != ([4]byte{}) {
+		buf = append(buf, optGateway, 4)
+		buf = append(buf, boot.Gateway[:]...)
+	}
+	if boot.RootPath != "" {
+		rp := []byte(boot.RootPath)
+		buf = append(buf, optRootPath, byte(len(rp)))
+		buf = append(buf, rp...)
+	}
+	buf = append(buf, optEnd)
+
+	return buf
+}
+
+// serveBootp runs a minimal BOOTP/DHCPv4 responder on ifc's UDP port 67,
+// answering every BOOTREQUEST whose CHAddr resolves via source with a
+// broadcast BOOTREPLY carrying the same next-server/bootfile/rootpath the
+// RARP path would hand out, advertising leaseSeconds via DHCP option 51.
+// It is meant to run alongside the RARP loop in main, not replace it: Sun
+// diskless clients that speak BOOTP instead of (or in addition to) RARP
+// get the same answer either way.
+func serveBootp(ifc *net.Interface, serverIP net.IP, source mapping.Source, leaseSeconds uint32, verbose bool) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, unix.IPPROTO_UDP)
+	if err != nil {
+		return fmt.Errorf("socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_BROADCAST, 1); err != nil {
+		return fmt.Errorf("SO_BROADCAST: %w", err)
+	}
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		return fmt.Errorf("SO_REUSEADDR: %w", err)
+	}
+	if err := unix.BindToDevice(fd, ifc.Name); err != nil {
+		return fmt.Errorf("SO_BINDTODEVICE: %w", err)
+	}
+
+	addr := &unix.SockaddrInet4{Port: bootpPort}
+	if err := unix.Bind(fd, addr); err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+
+	log.Printf("BOOTP server on %s listening on udp/%d...", ifc.Name, bootpPort)
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("recvfrom: %w", err)
+		}
+		req, opts, err := parseBootpRequest(buf[:n])
+		if err != nil {
+			if verbose { log.Printf("bootp: skip packet: %v", err) }
+			continue
+		}
+		var chaddr [6]byte
+		copy(chaddr[:], req.CHAddr[:6])
+		ip, boot, ok := source.Lookup(chaddr)
+		if !ok {
+			if verbose { log.Printf("bootp: no mapping for %02x:%02x:%02x:%02x:%02x:%02x", chaddr[0], chaddr[1], chaddr[2], chaddr[3], chaddr[4], chaddr[5]) }
+			continue
+		}
+
+		reply := buildBootpReply(serverIP, req, opts, ip, boot, leaseSeconds)
+		dst := &unix.SockaddrInet4{Port: bootpClientPort, Addr: [4]byte{255, 255, 255, 255}}
+		if err := unix.Sendto(fd, reply, 0, dst); err != nil {
+			log.Printf("bootp: sendto: %v", err)
+			continue
+		}
+		if verbose {
+			log.Printf("bootp: answered request for %02x:%02x:%02x:%02x:%02x:%02x -> %d.%d.%d.%d",
+				chaddr[0], chaddr[1], chaddr[2], chaddr[3], chaddr[4], chaddr[5],
+				ip[0], ip[1], ip[2], ip[3])
+		}
+	}
+}
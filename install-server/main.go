@@ -1,17 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
-	"os"
-	"strings"
-	"syscall"
 
+	"github.com/kakwa/sun-v100-case/internal/bpf"
+	"github.com/kakwa/sun-v100-case/pkg/mapping"
+	"github.com/kakwa/sun-v100-case/pkg/rarp"
 	"golang.org/x/sys/unix"
 )
 
@@ -55,36 +54,28 @@ type RarpPacket struct {
 
 func htons(i uint16) uint16 { return (i<<8)&0xff00 | i>>8 }
 
-func parseMapping(s string) (map[[6]byte][4]byte, error) {
-	m := make(map[[6]byte][4]byte)
-	if s == "" {
-		return m, nil
+// buildMappingSource picks the active mapping.Source from the handful of
+// mutually exclusive -map* flags. At most one of them may be set; an
+// empty mapStr with nothing else set yields an Inline source with no
+// entries (matching the previous -map "" default of answering nothing).
+func buildMappingSource(mapStr, mapFile, mapLeases, dynamicCIDR, dynamicState string) (mapping.Source, error) {
+	set := 0
+	for _, s := range []string{mapStr, mapFile, mapLeases, dynamicCIDR} {
+		if s != "" { set++ }
 	}
-	pairs := strings.Split(s, ",")
-	for _, p := range pairs {
-		p = strings.TrimSpace(p)
-		if p == "" { continue }
-		kv := strings.SplitN(p, "=", 2)
-		if len(kv) != 2 {
-			return nil, fmt.Errorf("invalid mapping entry: %q (want mac=ipv4)", p)
-		}
-		macStr := strings.TrimSpace(kv[0])
-		ipStr := strings.TrimSpace(kv[1])
-		mac, err := net.ParseMAC(macStr)
-		if err != nil {
-			return nil, fmt.Errorf("parse MAC %q: %w", macStr, err)
-		}
-		ip := net.ParseIP(ipStr).To4()
-		if ip == nil {
-			return nil, fmt.Errorf("parse IPv4 %q: invalid", ipStr)
-		}
-		var mac6 [6]byte
-		copy(mac6[:], mac[:6])
-		var ip4 [4]byte
-		copy(ip4[:], ip[:4])
-		m[mac6] = ip4
+	if set > 1 {
+		return nil, errors.New("-map, -map-file, -map-leases and -map-dynamic are mutually exclusive")
+	}
+	switch {
+	case mapFile != "":
+		return mapping.NewFile(mapFile)
+	case mapLeases != "":
+		return mapping.NewLeases(mapLeases)
+	case dynamicCIDR != "":
+		return mapping.NewDynamic(dynamicCIDR, dynamicState)
+	default:
+		return mapping.ParseInline(mapStr)
 	}
-	return m, nil
 }
 
 func ifaceByName(name string) (*net.Interface, error) {
@@ -110,13 +101,15 @@ func firstIPv4Addr(name string) (net.IP, error) {
 	return nil, errors.New("no IPv4 on interface")
 }
 
-func openRawSocket(ifc *net.Interface) (int, error) {
-	// AF_PACKET/SOCK_RAW for Ethernet frames on Linux
-	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(ETH_P_RARP)))
+// openRawSocket opens an AF_PACKET/SOCK_RAW socket bound to ifc, filtered
+// to only receive frames of the given ethertype (host byte order, e.g.
+// ETH_P_RARP or ETH_P_IP). Only the RARP listener uses it; serveBootp
+// opens its own UDP socket on port 67 instead.
+func openRawSocket(ifc *net.Interface, ethertype uint16) (int, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(ethertype)))
 	if err != nil { return -1, fmt.Errorf("socket: %w", err) }
 
-	// Bind to device + protocol
-	ll := &unix.SockaddrLinklayer{Protocol: htons(ETH_P_RARP), Ifindex: ifc.Index}
+	ll := &unix.SockaddrLinklayer{Protocol: htons(ethertype), Ifindex: ifc.Index}
 	if err := unix.Bind(fd, ll); err != nil {
 		unix.Close(fd)
 		return -1, fmt.Errorf("bind: %w", err)
@@ -190,70 +183,135 @@ func parseIncomingRarp(b []byte) (EthHdr, RarpPacket, error) {
 
 func main() {
 	iface := flag.String("i", "eth0", "interface to bind (Linux only)")
-	mapping := flag.String("map", "", "comma-separated MAC=IPv4 mappings (e.g. 52:54:00:12:34:56=192.168.1.10,aa:bb:cc:dd:ee:ff=192.168.1.11)")
+	mapStr := flag.String("map", "", "';'-separated MAC=IPv4 mappings, each optionally followed by ',bootfile=...,root=...,gw=...,next=...,mask=...' boot parameters (breaking change: entries used to be ','-separated; rewrite old comma-separated configs to use ';' between hosts)")
+	mapFile := flag.String("map-file", "", "load MAC=IPv4 mappings from a YAML/JSON file, hot-reloaded on change (mutually exclusive with -map, -map-leases, -map-dynamic)")
+	mapLeases := flag.String("map-leases", "", "resolve MAC=IPv4 mappings from an ISC dhcpd.leases file (mutually exclusive with -map, -map-file, -map-dynamic)")
+	mapDynamicCIDR := flag.String("map-dynamic", "", "hand out IPv4 addresses from this CIDR pool to any unmapped MAC (mutually exclusive with -map, -map-file, -map-leases)")
+	mapDynamicState := flag.String("map-dynamic-state", "dynamic-leases.txt", "file where -map-dynamic bindings are persisted across restarts")
 	verbose := flag.Bool("v", false, "verbose logging")
+	bootp := flag.Bool("bootp", false, "also answer BOOTP/DHCPv4 requests on the same interface")
+	bootpLeaseTime := flag.Uint("bootp-lease-time", 86400, "DHCP option 51 lease time in seconds advertised by -bootp (ignored by plain BOOTP clients)")
+	bpfFilter := flag.Bool("bpf", false, "attach a kernel BPF filter dropping non-RARP-request frames before they reach userspace")
+	pcapIn := flag.String("pcap-in", "", "read Ethernet frames from this pcap file instead of a live AF_PACKET socket (for offline testing, without root or a real NIC)")
+	pcapOut := flag.String("pcap-out", "", "write generated RARP replies to this pcap file (only used with -pcap-in)")
+	serverMACFlag := flag.String("server-mac", "", "server MAC address stamped into replies; only used with -pcap-in, where it overrides the MAC of -i (needed when -i does not name a real interface)")
+	serverIPFlag := flag.String("server-ip", "", "server IPv4 address stamped into replies; only used with -pcap-in, where it overrides the IPv4 of -i (needed when -i does not name a real interface)")
 	flag.Parse()
 
-	ifc, err := ifaceByName(*iface)
-	if err != nil { log.Fatalf("%v", err) }
+	var ifc *net.Interface
+	var serverIP net.IP
+	var serverMAC net.HardwareAddr
+	var err error
+
+	if *pcapIn != "" {
+		// -i naming a real, up interface is optional here: replay only
+		// needs an ifc to hand to openRawSocket/serveBootp, neither of
+		// which run in this branch. Fall back to -server-mac/-server-ip
+		// (or the zero MAC/IP) so replay works against a pcap file alone.
+		ifc, _ = ifaceByName(*iface)
+		serverIP, _ = firstIPv4Addr(*iface)
+
+		if *serverMACFlag != "" {
+			serverMAC, err = net.ParseMAC(*serverMACFlag)
+			if err != nil { log.Fatalf("-server-mac: %v", err) }
+		} else if ifc != nil {
+			serverMAC = ifc.HardwareAddr
+		} else {
+			serverMAC = make(net.HardwareAddr, 6)
+		}
 
-	serverIP, err := firstIPv4Addr(*iface)
-	if err != nil { log.Fatalf("%v", err) }
+		if *serverIPFlag != "" {
+			ip := net.ParseIP(*serverIPFlag).To4()
+			if ip == nil { log.Fatalf("-server-ip: invalid IPv4 %q", *serverIPFlag) }
+			serverIP = ip
+		} else if serverIP == nil {
+			serverIP = net.IPv4zero
+		}
+	} else {
+		ifc, err = ifaceByName(*iface)
+		if err != nil { log.Fatalf("%v", err) }
+
+		serverIP, err = firstIPv4Addr(*iface)
+		if err != nil { log.Fatalf("%v", err) }
 
-	macToIP, err := parseMapping(*mapping)
+		serverMAC = ifc.HardwareAddr
+	}
+
+	source, err := buildMappingSource(*mapStr, *mapFile, *mapLeases, *mapDynamicCIDR, *mapDynamicState)
 	if err != nil { log.Fatalf("%v", err) }
 
-	fd, err := openRawSocket(ifc)
+	if *pcapIn != "" {
+		if err := runPcapReplay(serverMAC, serverIP, source, *pcapIn, *pcapOut, *verbose); err != nil {
+			log.Fatalf("pcap replay: %v", err)
+		}
+		return
+	}
+
+	fd, err := openRawSocket(ifc, ETH_P_RARP)
 	if err != nil { log.Fatalf("%v", err) }
-	defer unix.Close(fd)
+	if *bpfFilter {
+		if err := bpf.Attach(fd, bpf.RarpRequestFilter()); err != nil {
+			log.Fatalf("attach bpf filter: %v", err)
+		}
+	}
+	conn := rarp.NewConn(fd, rarp.DefaultBatchSize)
+	defer conn.Close()
+
+	if *bootp {
+		go func() {
+			if err := serveBootp(ifc, serverIP, source, uint32(*bootpLeaseTime), *verbose); err != nil {
+				log.Fatalf("bootp: %v", err)
+			}
+		}()
+	}
 
 	log.Printf("RARP server on %s (MAC %s, IP %s) listening for requests...", ifc.Name, ifc.HardwareAddr, serverIP)
 
-	reader := bufio.NewReader(os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd)))
 	for {
-		// Read a single Ethernet frame (up to MTU; 1518 is safe default)
-		buf := make([]byte, 2048)
-		n, err := reader.Read(buf)
-		if err != nil {
-			log.Fatalf("read: %v", err)
-		}
-		frame := buf[:n]
-		eth, pkt, err := parseIncomingRarp(frame)
+		// Drain whatever frames arrived since the last receive in at most
+		// two recvmmsg(2) calls instead of one read() per frame.
+		frames, err := conn.ReceiveBatch()
 		if err != nil {
-			// not RARP or malformed; skip silently unless verbose
-			if *verbose { log.Printf("skip frame: %v", err) }
-			continue
-		}
-
-		// Only handle RARP requests
-		if pkt.Oper != htons(RARP_REQUEST) {
-			if *verbose { log.Printf("ignore opcode %d", pkt.Oper) }
-			continue
+			log.Fatalf("receive: %v", err)
 		}
 
-		// Target MAC is who is asking for its IP
-		var targetMAC [6]byte = pkt.THA
-		ip4, ok := macToIP[targetMAC]
-		if !ok {
-			if *verbose { log.Printf("no mapping for %02x:%02x:%02x:%02x:%02x:%02x", targetMAC[0], targetMAC[1], targetMAC[2], targetMAC[3], targetMAC[4], targetMAC[5]) }
-			continue
-		}
-
-		reply, err := buildRarpReply(ifc.HardwareAddr, serverIP, net.HardwareAddr(pkt.THA[:]), net.IP(ip4[:]))
-		if err != nil { log.Printf("build reply: %v", err); continue }
-
-		// Send using sendto() with SockaddrLinklayer (dst MAC is in frame)
-		ll := &unix.SockaddrLinklayer{Ifindex: ifc.Index}
-		if err := unix.Sendto(fd, reply, 0, ll); err != nil {
-			log.Printf("sendto: %v", err)
-			continue
+		var replies [][]byte
+		for _, frame := range frames {
+			_, pkt, err := parseIncomingRarp(frame)
+			if err != nil {
+				// not RARP or malformed; skip silently unless verbose
+				if *verbose { log.Printf("skip frame: %v", err) }
+				continue
+			}
+
+			// Only handle RARP requests
+			if pkt.Oper != htons(RARP_REQUEST) {
+				if *verbose { log.Printf("ignore opcode %d", pkt.Oper) }
+				continue
+			}
+
+			// Target MAC is who is asking for its IP
+			var targetMAC [6]byte = pkt.THA
+			ip4, _, ok := source.Lookup(targetMAC)
+			if !ok {
+				if *verbose { log.Printf("no mapping for %02x:%02x:%02x:%02x:%02x:%02x", targetMAC[0], targetMAC[1], targetMAC[2], targetMAC[3], targetMAC[4], targetMAC[5]) }
+				continue
+			}
+
+			reply, err := buildRarpReply(ifc.HardwareAddr, serverIP, net.HardwareAddr(pkt.THA[:]), net.IP(ip4[:]))
+			if err != nil { log.Printf("build reply: %v", err); continue }
+			replies = append(replies, reply)
+
+			if *verbose {
+				log.Printf("answered RARP for %02x:%02x:%02x:%02x:%02x:%02x -> %d.%d.%d.%d",
+					pkt.THA[0], pkt.THA[1], pkt.THA[2], pkt.THA[3], pkt.THA[4], pkt.THA[5],
+					ip4[0], ip4[1], ip4[2], ip4[3],
+				)
+			}
 		}
 
-		if *verbose {
-			log.Printf("answered RARP for %02x:%02x:%02x:%02x:%02x:%02x -> %d.%d.%d.%d",
-				pkt.THA[0], pkt.THA[1], pkt.THA[2], pkt.THA[3], pkt.THA[4], pkt.THA[5],
-				ip4[0], ip4[1], ip4[2], ip4[3],
-			)
+		if _, err := conn.SendBatch(replies); err != nil {
+			log.Printf("send batch: %v", err)
 		}
 	}
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"github.com/kakwa/sun-v100-case/pkg/mapping"
+	"github.com/kakwa/sun-v100-case/pkg/pcap"
+)
+
+// runPcapReplay feeds the Ethernet frames in pcapInPath through the same
+// parseIncomingRarp/buildRarpReply path the live RARP loop uses, instead
+// of reading from an AF_PACKET socket. Generated replies are written to
+// pcapOutPath (when set; an existing file is truncated) so a capture of production traffic can be
+// replayed and the server's answers inspected offline, without root or a
+// real NIC.
+func runPcapReplay(serverMAC net.HardwareAddr, serverIP net.IP, source mapping.Source, pcapInPath, pcapOutPath string, verbose bool) error {
+	in, err := os.Open(pcapInPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", pcapInPath, err)
+	}
+	defer in.Close()
+
+	r, err := pcap.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", pcapInPath, err)
+	}
+
+	var w *pcap.Writer
+	if pcapOutPath != "" {
+		out, err := os.Create(pcapOutPath)
+		if err != nil {
+			return fmt.Errorf("create %s: %w", pcapOutPath, err)
+		}
+		defer out.Close()
+		w, err = pcap.NewWriter(out, pcap.LinkTypeEthernet)
+		if err != nil {
+			return fmt.Errorf("write %s: %w", pcapOutPath, err)
+		}
+	}
+
+	for {
+		frame, ts, err := r.ReadPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read packet: %w", err)
+		}
+
+		_, pkt, err := parseIncomingRarp(frame)
+		if err != nil {
+			if verbose { log.Printf("pcap: skip frame: %v", err) }
+			continue
+		}
+		if pkt.Oper != htons(RARP_REQUEST) {
+			if verbose { log.Printf("pcap: ignore opcode %d", pkt.Oper) }
+			continue
+		}
+
+		ip4, _, ok := source.Lookup(pkt.THA)
+		if !ok {
+			if verbose { log.Printf("pcap: no mapping for %02x:%02x:%02x:%02x:%02x:%02x", pkt.THA[0], pkt.THA[1], pkt.THA[2], pkt.THA[3], pkt.THA[4], pkt.THA[5]) }
+			continue
+		}
+
+		reply, err := buildRarpReply(serverMAC, serverIP, net.HardwareAddr(pkt.THA[:]), net.IP(ip4[:]))
+		if err != nil {
+			log.Printf("pcap: build reply: %v", err)
+			continue
+		}
+
+		if verbose {
+			log.Printf("pcap: answered RARP for %02x:%02x:%02x:%02x:%02x:%02x -> %d.%d.%d.%d",
+				pkt.THA[0], pkt.THA[1], pkt.THA[2], pkt.THA[3], pkt.THA[4], pkt.THA[5],
+				ip4[0], ip4[1], ip4[2], ip4[3])
+		}
+
+		if w != nil {
+			if err := w.WritePacket(reply, ts); err != nil {
+				return fmt.Errorf("write reply: %w", err)
+			}
+		}
+	}
+}
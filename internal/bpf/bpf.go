@@ -0,0 +1,71 @@
+// Package bpf builds and attaches classical BPF (Linux Socket Filter)
+// programs to AF_PACKET sockets, so frames we don't care about are
+// dropped in the kernel instead of being copied to userspace and
+// rejected by parseIncomingRarp.
+package bpf
+
+import "golang.org/x/sys/unix"
+
+// Classic BPF opcodes used below (see linux/filter.h / linux/bpf_common.h).
+const (
+	opLdhAbs = 0x28 // BPF_LD | BPF_H | BPF_ABS
+	opLdbAbs = 0x30 // BPF_LD | BPF_B | BPF_ABS
+	opJeqK   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	opRetK   = 0x06 // BPF_RET | BPF_K
+)
+
+func stmt(code uint16, k uint32) unix.SockFilter { return unix.SockFilter{Code: code, K: k} }
+
+func jump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// RarpRequestFilter returns a classical BPF program that accepts only
+// Ethernet frames carrying an RARP request - HType=1, PType=0x0800
+// (IPv4), HLEN=6, PLEN=4, Oper=3 (RARP_REQUEST) - and drops everything
+// else before it is copied out of the kernel. Userspace still checks the
+// frame length and ethertype (parseIncomingRarp) and the opcode after it;
+// the HType/PType/HLEN/PLEN checks are made only here.
+//
+// Offsets into the raw frame as seen by an AF_PACKET socket:
+//
+//	12: ethertype (2 bytes)   18: arp hlen (1 byte)
+//	14: arp htype (2 bytes)   19: arp plen (1 byte)
+//	16: arp ptype (2 bytes)   20: arp oper (2 bytes)
+func RarpRequestFilter() []unix.SockFilter {
+	const (
+		ethPRarp  = 0x8035
+		ethPIP    = 0x0800
+		arpHType  = 1
+		arpHLen   = 6
+		arpPLen   = 4
+		rarpOpReq = 3
+	)
+	return []unix.SockFilter{
+		stmt(opLdhAbs, 12),                 // 0: A = ethertype
+		jump(opJeqK, ethPRarp, 0, 11),       // 1: A == RARP ethertype? : reject
+		stmt(opLdhAbs, 14),                 // 2: A = arp htype
+		jump(opJeqK, arpHType, 0, 9),       // 3
+		stmt(opLdhAbs, 16),                 // 4: A = arp ptype
+		jump(opJeqK, ethPIP, 0, 7),         // 5
+		stmt(opLdbAbs, 18),                 // 6: A = arp hlen
+		jump(opJeqK, arpHLen, 0, 5),        // 7
+		stmt(opLdbAbs, 19),                 // 8: A = arp plen
+		jump(opJeqK, arpPLen, 0, 3),        // 9
+		stmt(opLdhAbs, 20),                 // 10: A = arp oper
+		jump(opJeqK, rarpOpReq, 0, 1),      // 11
+		stmt(opRetK, 0xffffffff),           // 12: accept, keep whole frame
+		stmt(opRetK, 0),                    // 13: reject
+	}
+}
+
+// Attach installs prog on fd via SO_ATTACH_FILTER, so the kernel drops
+// any frame prog doesn't accept before it reaches this socket's receive
+// queue.
+func Attach(fd int, prog []unix.SockFilter) error {
+	fprog := unix.SockFprog{
+		Len:    uint16(len(prog)),
+		Filter: &prog[0],
+	}
+	return unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &fprog)
+}
@@ -0,0 +1,114 @@
+package bpf
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRarpRequestFilterShape(t *testing.T) {
+	prog := RarpRequestFilter()
+	if len(prog) < 2 {
+		t.Fatalf("program too short: %d instructions", len(prog))
+	}
+	last := len(prog) - 1
+	if prog[last].Code != opRetK || prog[last].K != 0 {
+		t.Errorf("last instruction should be a reject (ret 0), got %+v", prog[last])
+	}
+	if prog[last-1].Code != opRetK || prog[last-1].K == 0 {
+		t.Errorf("second-to-last instruction should be an accept (ret != 0), got %+v", prog[last-1])
+	}
+}
+
+// runFilter interprets prog against pkt the way the kernel's classic BPF
+// machine would, supporting exactly the opcodes RarpRequestFilter emits
+// (LD_H/B|ABS, JEQ|K, RET|K). It returns the K of whichever RET
+// instruction the program lands on - 0 for reject, non-zero for accept -
+// so tests can catch a wrong jt/jf offset without a live socket.
+func runFilter(prog []unix.SockFilter, pkt []byte) (uint32, error) {
+	var a uint32
+	for pc := 0; pc < len(prog); {
+		ins := prog[pc]
+		switch ins.Code {
+		case opLdhAbs:
+			if int(ins.K)+2 > len(pkt) {
+				return 0, fmt.Errorf("instruction %d: LDH at %d out of bounds (packet len %d)", pc, ins.K, len(pkt))
+			}
+			a = uint32(pkt[ins.K])<<8 | uint32(pkt[ins.K+1])
+			pc++
+		case opLdbAbs:
+			if int(ins.K)+1 > len(pkt) {
+				return 0, fmt.Errorf("instruction %d: LDB at %d out of bounds (packet len %d)", pc, ins.K, len(pkt))
+			}
+			a = uint32(pkt[ins.K])
+			pc++
+		case opJeqK:
+			if a == ins.K {
+				pc += 1 + int(ins.Jt)
+			} else {
+				pc += 1 + int(ins.Jf)
+			}
+		case opRetK:
+			return ins.K, nil
+		default:
+			return 0, fmt.Errorf("instruction %d: unsupported opcode 0x%02x", pc, ins.Code)
+		}
+	}
+	return 0, fmt.Errorf("program ran off the end without a RET")
+}
+
+// rarpRequestFrame builds a minimal 22-byte Ethernet+ARP header matching
+// the offsets RarpRequestFilter checks, with every field defaulting to
+// the value a valid RARP request carries; tweak() lets a test corrupt one
+// field to exercise a specific jf branch.
+func rarpRequestFrame(tweak func(b []byte)) []byte {
+	b := make([]byte, 22)
+	b[12], b[13] = 0x80, 0x35 // ethertype: RARP
+	b[14], b[15] = 0x00, 0x01 // arp htype: Ethernet
+	b[16], b[17] = 0x08, 0x00 // arp ptype: IPv4
+	b[18] = 6                // arp hlen
+	b[19] = 4                // arp plen
+	b[20], b[21] = 0x00, 0x03 // arp oper: RARP_REQUEST
+	if tweak != nil {
+		tweak(b)
+	}
+	return b
+}
+
+func TestRarpRequestFilterAcceptsRarpRequest(t *testing.T) {
+	prog := RarpRequestFilter()
+	n, err := runFilter(prog, rarpRequestFrame(nil))
+	if err != nil {
+		t.Fatalf("runFilter: %v", err)
+	}
+	if n == 0 {
+		t.Errorf("a well-formed RARP request was rejected")
+	}
+}
+
+func TestRarpRequestFilterRejectsMismatches(t *testing.T) {
+	cases := []struct {
+		name  string
+		tweak func(b []byte)
+	}{
+		{"wrong ethertype", func(b []byte) { b[12], b[13] = 0x08, 0x00 }},
+		{"wrong arp htype", func(b []byte) { b[14], b[15] = 0x00, 0x06 }},
+		{"wrong arp ptype", func(b []byte) { b[16], b[17] = 0x86, 0xdd }},
+		{"wrong arp hlen", func(b []byte) { b[18] = 8 }},
+		{"wrong arp plen", func(b []byte) { b[19] = 16 }},
+		{"wrong arp oper (RARP reply, not request)", func(b []byte) { b[20], b[21] = 0x00, 0x04 }},
+	}
+	prog := RarpRequestFilter()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			n, err := runFilter(prog, rarpRequestFrame(c.tweak))
+			if err != nil {
+				t.Fatalf("runFilter: %v", err)
+			}
+			if n != 0 {
+				t.Errorf("expected frame to be rejected, got accept length %d", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package mapping
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dynamic hands out IPv4 addresses from a CIDR pool the first time it
+// sees a MAC, and persists MAC->IP bindings to statePath (one "mac ip"
+// pair per line) so they survive a restart. Addresses are allocated
+// lazily by walking the range instead of precomputing every address into
+// memory up front (a /8 pool is 16 million addresses), and new
+// allocations are rate-limited: a spoofed-MAC RARP flood can only burn
+// through the pool, and rewrite statePath, as fast as the limiter lets
+// it. Lookups of a MAC that already has a binding are never limited. It
+// has no notion of boot parameters, so Lookup always returns the zero
+// BootInfo.
+type Dynamic struct {
+	mu        sync.Mutex
+	statePath string
+	next      uint32 // next candidate address to try, host order
+	last      uint32 // highest usable address (inclusive)
+	used      map[[4]byte]bool
+	entries   map[[6]byte][4]byte
+	limiter   allocLimiter
+}
+
+// defaultAllocBurst/-Window bound how many *new* MACs Dynamic will bind
+// per window; a MAC that already has a binding is never rate-limited.
+const (
+	defaultAllocBurst  = 16
+	defaultAllocWindow = time.Second
+)
+
+// allocLimiter is a fixed-window counter: up to max allocations are let
+// through per window, and the rest are refused until the window rolls
+// over.
+type allocLimiter struct {
+	max     int
+	window  time.Duration
+	count   int
+	resetAt time.Time
+}
+
+func (l *allocLimiter) allow(now time.Time) bool {
+	if now.After(l.resetAt) {
+		l.count = 0
+		l.resetAt = now.Add(l.window)
+	}
+	if l.count >= l.max {
+		return false
+	}
+	l.count++
+	return true
+}
+
+// NewDynamic builds an allocator handing out addresses from cidr,
+// restoring any bindings already persisted at statePath.
+func NewDynamic(cidr, statePath string) (*Dynamic, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("parse cidr %q: %w", cidr, err)
+	}
+	ip4 := network.IP.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("parse cidr %q: not an IPv4 range", cidr)
+	}
+
+	base := binary.BigEndian.Uint32(ip4)
+	broadcast := base | ^binary.BigEndian.Uint32(network.Mask)
+
+	first, last := base, broadcast
+	if broadcast-base > 1 {
+		// drop the network and broadcast addresses from the usable range
+		first, last = base+1, broadcast-1
+	}
+
+	d := &Dynamic{
+		statePath: statePath,
+		next:      first,
+		last:      last,
+		used:      make(map[[4]byte]bool),
+		entries:   make(map[[6]byte][4]byte),
+		limiter:   allocLimiter{max: defaultAllocBurst, window: defaultAllocWindow},
+	}
+
+	if err := d.restore(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Dynamic) restore() error {
+	f, err := os.Open(d.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open %s: %w", d.statePath, err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[0])
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(fields[1]).To4()
+		if ip == nil {
+			continue
+		}
+		var mac6 [6]byte
+		copy(mac6[:], mac[:6])
+		var ip4 [4]byte
+		copy(ip4[:], ip[:4])
+		d.entries[mac6] = ip4
+		d.used[ip4] = true
+	}
+	return sc.Err()
+}
+
+func (d *Dynamic) persist() error {
+	f, err := os.Create(d.statePath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", d.statePath, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for mac, ip := range d.entries {
+		hw := net.HardwareAddr(mac[:])
+		fmt.Fprintf(w, "%s %d.%d.%d.%d\n", hw, ip[0], ip[1], ip[2], ip[3])
+	}
+	return w.Flush()
+}
+
+// allocate hands out the next unused address in [next, last], advancing
+// the iterator so each candidate is only ever considered once. It skips
+// over addresses already in d.used (e.g. restored from statePath) rather
+// than precomputing the usable set up front.
+func (d *Dynamic) allocate() ([4]byte, bool) {
+	for d.next <= d.last {
+		var ip4 [4]byte
+		binary.BigEndian.PutUint32(ip4[:], d.next)
+		d.next++
+		if !d.used[ip4] {
+			d.used[ip4] = true
+			return ip4, true
+		}
+	}
+	return [4]byte{}, false
+}
+
+// Lookup returns the existing binding for mac, allocating the next free
+// address from the pool (and persisting it) the first time mac is seen.
+// ok is false once the pool is exhausted, or a new MAC arrives faster
+// than the allocation rate limit allows.
+func (d *Dynamic) Lookup(mac [6]byte) ([4]byte, BootInfo, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ip, ok := d.entries[mac]; ok {
+		return ip, BootInfo{}, true
+	}
+	if !d.limiter.allow(time.Now()) {
+		return [4]byte{}, BootInfo{}, false
+	}
+
+	ip4, ok := d.allocate()
+	if !ok {
+		return [4]byte{}, BootInfo{}, false
+	}
+	d.entries[mac] = ip4
+	if err := d.persist(); err != nil {
+		// Best effort: the binding still holds for this process's
+		// lifetime even if we couldn't save it to disk.
+		_ = err
+	}
+	return ip4, BootInfo{}, true
+}
@@ -0,0 +1,83 @@
+package mapping
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDynamicAllocatesAndPersists(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "leases.txt")
+
+	d, err := NewDynamic("192.168.50.0/30", statePath)
+	if err != nil {
+		t.Fatalf("NewDynamic: %v", err)
+	}
+
+	mac := [6]byte{0x52, 0x54, 0x00, 0x00, 0x00, 0x01}
+	ip, _, ok := d.Lookup(mac)
+	if !ok {
+		t.Fatalf("expected an allocation from the /30's usable range")
+	}
+	if want := ([4]byte{192, 168, 50, 1}); ip != want {
+		t.Errorf("ip = %v, want %v", ip, want)
+	}
+
+	// same MAC must get the same address back
+	if ip2, _, ok := d.Lookup(mac); !ok || ip2 != ip {
+		t.Errorf("second Lookup = %v, %v, want %v, true", ip2, ok, ip)
+	}
+
+	// a /30 has two usable host addresses; a second MAC still gets one
+	other := [6]byte{0x52, 0x54, 0x00, 0x00, 0x00, 0x02}
+	if ip2, _, ok := d.Lookup(other); !ok || ip2 != ([4]byte{192, 168, 50, 2}) {
+		t.Errorf("Lookup(other) = %v, %v, want {192 168 50 2}, true", ip2, ok)
+	}
+
+	// pool now exhausted: a third MAC gets nothing
+	third := [6]byte{0x52, 0x54, 0x00, 0x00, 0x00, 0x03}
+	if _, _, ok := d.Lookup(third); ok {
+		t.Errorf("expected pool exhaustion on a third MAC for a /30")
+	}
+
+	// bindings survive a restart
+	d2, err := NewDynamic("192.168.50.0/30", statePath)
+	if err != nil {
+		t.Fatalf("NewDynamic (reload): %v", err)
+	}
+	if ip2, _, ok := d2.Lookup(mac); !ok || ip2 != ip {
+		t.Errorf("after reload: Lookup = %v, %v, want %v, true", ip2, ok, ip)
+	}
+}
+
+func TestDynamicRateLimitsNewAllocations(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDynamic("10.0.0.0/16", filepath.Join(dir, "leases.txt"))
+	if err != nil {
+		t.Fatalf("NewDynamic: %v", err)
+	}
+
+	bound := [6]byte{0x52, 0x54, 0x00, 0x00, 0x00, 0x01}
+	if _, _, ok := d.Lookup(bound); !ok {
+		t.Fatalf("expected first allocation to succeed")
+	}
+
+	for i := 0; i < defaultAllocBurst-1; i++ {
+		mac := [6]byte{0x52, 0x54, 0x00, 0x00, 0x01, byte(i)}
+		if _, _, ok := d.Lookup(mac); !ok {
+			t.Fatalf("allocation %d should still be within the burst window", i)
+		}
+	}
+
+	// the burst window is now spent; a brand new MAC should be refused
+	// even though the /16 pool is nowhere near exhausted.
+	flood := [6]byte{0x52, 0x54, 0x00, 0x00, 0x02, 0x01}
+	if _, _, ok := d.Lookup(flood); ok {
+		t.Errorf("expected a new MAC to be rate-limited once the burst is spent")
+	}
+
+	// a MAC that already has a binding is never rate-limited.
+	if _, _, ok := d.Lookup(bound); !ok {
+		t.Errorf("expected an already-bound MAC to bypass the rate limit")
+	}
+}
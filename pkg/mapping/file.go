@@ -0,0 +1,156 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// FileHost is one entry in a mapping file. The file format (YAML or
+// JSON) is picked from the file extension: ".yaml"/".yml" is parsed as
+// YAML, anything else as JSON.
+type FileHost struct {
+	MAC      string `yaml:"mac" json:"mac"`
+	IP       string `yaml:"ip" json:"ip"`
+	Bootfile string `yaml:"bootfile,omitempty" json:"bootfile,omitempty"`
+	RootPath string `yaml:"root,omitempty" json:"root,omitempty"`
+	Gateway  string `yaml:"gw,omitempty" json:"gw,omitempty"`
+	Next     string `yaml:"next,omitempty" json:"next,omitempty"`
+	Netmask  string `yaml:"mask,omitempty" json:"mask,omitempty"`
+}
+
+// File is a Source backed by a YAML or JSON file on disk, reloaded
+// automatically whenever the file changes so an admin can edit the MAC
+// set without restarting the server.
+type File struct {
+	path string
+
+	mu      sync.RWMutex
+	entries map[[6]byte]hostEntry
+
+	watcher *fsnotify.Watcher
+}
+
+// NewFile loads path and starts watching it for changes. Call Close to
+// stop the watcher goroutine.
+func NewFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("fsnotify: %w", err)
+	}
+	if err := w.Add(path); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("watch %s: %w", path, err)
+	}
+	f.watcher = w
+	go f.watchLoop()
+	return f, nil
+}
+
+func (f *File) watchLoop() {
+	for {
+		select {
+		case ev, ok := <-f.watcher.Events:
+			if !ok { return }
+			if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 { continue }
+			if err := f.reload(); err != nil {
+				log.Printf("mapping: reload %s: %v", f.path, err)
+			}
+		case err, ok := <-f.watcher.Errors:
+			if !ok { return }
+			log.Printf("mapping: watch %s: %v", f.path, err)
+		}
+	}
+}
+
+func (f *File) reload() error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", f.path, err)
+	}
+
+	var hosts []FileHost
+	if strings.HasSuffix(f.path, ".yaml") || strings.HasSuffix(f.path, ".yml") {
+		if err := yaml.Unmarshal(data, &hosts); err != nil {
+			return fmt.Errorf("parse yaml: %w", err)
+		}
+	} else {
+		if err := json.Unmarshal(data, &hosts); err != nil {
+			return fmt.Errorf("parse json: %w", err)
+		}
+	}
+
+	entries := make(map[[6]byte]hostEntry, len(hosts))
+	for _, h := range hosts {
+		mac, err := net.ParseMAC(h.MAC)
+		if err != nil {
+			return fmt.Errorf("parse mac %q: %w", h.MAC, err)
+		}
+		ip := net.ParseIP(h.IP).To4()
+		if ip == nil {
+			return fmt.Errorf("parse ip %q: invalid", h.IP)
+		}
+
+		var ent hostEntry
+		copy(ent.ip[:], ip[:4])
+		ent.boot.Bootfile = h.Bootfile
+		ent.boot.RootPath = h.RootPath
+		if h.Gateway != "" {
+			gw := net.ParseIP(h.Gateway).To4()
+			if gw == nil {
+				return fmt.Errorf("parse gw %q: invalid", h.Gateway)
+			}
+			copy(ent.boot.Gateway[:], gw[:4])
+		}
+		if h.Next != "" {
+			next := net.ParseIP(h.Next).To4()
+			if next == nil {
+				return fmt.Errorf("parse next %q: invalid", h.Next)
+			}
+			copy(ent.boot.NextServer[:], next[:4])
+		}
+		if h.Netmask != "" {
+			mask := net.ParseIP(h.Netmask).To4()
+			if mask == nil {
+				return fmt.Errorf("parse mask %q: invalid", h.Netmask)
+			}
+			copy(ent.boot.Netmask[:], mask[:4])
+		}
+
+		var mac6 [6]byte
+		copy(mac6[:], mac[:6])
+		entries[mac6] = ent
+	}
+
+	f.mu.Lock()
+	f.entries = entries
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *File) Lookup(mac [6]byte) ([4]byte, BootInfo, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	e, ok := f.entries[mac]
+	return e.ip, e.boot, ok
+}
+
+// Close stops the file watcher.
+func (f *File) Close() error {
+	if f.watcher != nil {
+		return f.watcher.Close()
+	}
+	return nil
+}
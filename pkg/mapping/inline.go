@@ -0,0 +1,104 @@
+package mapping
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+type hostEntry struct {
+	ip   [4]byte
+	boot BootInfo
+}
+
+// Inline is the -map string format, parsed once at startup: ';'-separated
+// "mac=ipv4" entries, each optionally followed by ',key=value' boot
+// parameters ("bootfile", "root", "gw", "next", "mask"). Example:
+//
+//	52:54:00:12:34:56=192.168.1.10,bootfile=tftpboot/sun4u,root=/srv/nfs/sun1,gw=192.168.1.1
+//
+// This is a breaking change from the pre-boot-parameter format, which
+// used ',' between entries: a comma now always separates a boot
+// parameter from the mac=ipv4 pair (or from the previous parameter), so
+// an old multi-host "mac1=ip1,mac2=ip2" config must be rewritten with
+// ';' between hosts before upgrading.
+type Inline struct {
+	entries map[[6]byte]hostEntry
+}
+
+// ParseInline parses s into an Inline source.
+func ParseInline(s string) (*Inline, error) {
+	entries := make(map[[6]byte]hostEntry)
+	if s == "" {
+		return &Inline{entries: entries}, nil
+	}
+
+	for _, e := range strings.Split(s, ";") {
+		e = strings.TrimSpace(e)
+		if e == "" { continue }
+		fields := strings.Split(e, ",")
+		kv := strings.SplitN(strings.TrimSpace(fields[0]), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mapping entry: %q (want mac=ipv4)", fields[0])
+		}
+		macStr := strings.TrimSpace(kv[0])
+		ipStr := strings.TrimSpace(kv[1])
+		mac, err := net.ParseMAC(macStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse MAC %q: %w", macStr, err)
+		}
+		ip := net.ParseIP(ipStr).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("parse IPv4 %q: invalid", ipStr)
+		}
+
+		var ent hostEntry
+		copy(ent.ip[:], ip[:4])
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if f == "" { continue }
+			fkv := strings.SplitN(f, "=", 2)
+			if len(fkv) != 2 {
+				return nil, fmt.Errorf("invalid boot parameter %q in entry %q", f, e)
+			}
+			key := strings.TrimSpace(fkv[0])
+			val := strings.TrimSpace(fkv[1])
+			switch key {
+			case "bootfile":
+				ent.boot.Bootfile = val
+			case "root":
+				ent.boot.RootPath = val
+			case "gw":
+				gw := net.ParseIP(val).To4()
+				if gw == nil {
+					return nil, fmt.Errorf("parse gateway %q: invalid", val)
+				}
+				copy(ent.boot.Gateway[:], gw[:4])
+			case "next":
+				next := net.ParseIP(val).To4()
+				if next == nil {
+					return nil, fmt.Errorf("parse next-server %q: invalid", val)
+				}
+				copy(ent.boot.NextServer[:], next[:4])
+			case "mask":
+				mask := net.ParseIP(val).To4()
+				if mask == nil {
+					return nil, fmt.Errorf("parse netmask %q: invalid", val)
+				}
+				copy(ent.boot.Netmask[:], mask[:4])
+			default:
+				return nil, fmt.Errorf("unknown boot parameter %q in entry %q", key, e)
+			}
+		}
+
+		var mac6 [6]byte
+		copy(mac6[:], mac[:6])
+		entries[mac6] = ent
+	}
+	return &Inline{entries: entries}, nil
+}
+
+func (m *Inline) Lookup(mac [6]byte) ([4]byte, BootInfo, bool) {
+	e, ok := m.entries[mac]
+	return e.ip, e.boot, ok
+}
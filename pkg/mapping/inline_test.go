@@ -0,0 +1,40 @@
+package mapping
+
+import "testing"
+
+func TestParseInline(t *testing.T) {
+	src, err := ParseInline("52:54:00:12:34:56=192.168.1.10,bootfile=boot.img,root=/srv/nfs/sun1,gw=192.168.1.1;aa:bb:cc:dd:ee:ff=192.168.1.11")
+	if err != nil {
+		t.Fatalf("ParseInline: %v", err)
+	}
+
+	mac := [6]byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	ip, boot, ok := src.Lookup(mac)
+	if !ok {
+		t.Fatalf("Lookup(%v) not found", mac)
+	}
+	if want := [4]byte{192, 168, 1, 10}; ip != want {
+		t.Errorf("ip = %v, want %v", ip, want)
+	}
+	if boot.Bootfile != "boot.img" {
+		t.Errorf("Bootfile = %q, want %q", boot.Bootfile, "boot.img")
+	}
+	if want := [4]byte{192, 168, 1, 1}; boot.Gateway != want {
+		t.Errorf("Gateway = %v, want %v", boot.Gateway, want)
+	}
+
+	other := [6]byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	if ip, _, ok := src.Lookup(other); !ok || ip != ([4]byte{192, 168, 1, 11}) {
+		t.Errorf("Lookup(%v) = %v, %v, want {192 168 1 11}, true", other, ip, ok)
+	}
+
+	if _, _, ok := src.Lookup([6]byte{1, 2, 3, 4, 5, 6}); ok {
+		t.Errorf("Lookup of unknown MAC should fail")
+	}
+}
+
+func TestParseInlineInvalid(t *testing.T) {
+	if _, err := ParseInline("not-a-valid-entry"); err == nil {
+		t.Error("expected error for malformed entry")
+	}
+}
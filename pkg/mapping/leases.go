@@ -0,0 +1,86 @@
+package mapping
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Leases is a Source backed by an ISC dhcpd leases file (dhcpd.leases),
+// letting install-server share state with an existing DHCP server
+// instead of needing a duplicate -map config. It has no notion of boot
+// parameters, so Lookup always returns the zero BootInfo.
+type Leases struct {
+	entries map[[6]byte][4]byte
+}
+
+// NewLeases parses path once at startup. dhcpd.leases is an append-only
+// log of "lease <ip> { ... }" blocks, so for a given MAC the last block
+// wins: if it ends "binding state active" the MAC maps to that block's
+// IP, otherwise any earlier binding for that MAC is cleared - an active
+// lease does not survive a later block returning the MAC to the free
+// pool.
+func NewLeases(path string) (*Leases, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	entries := make(map[[6]byte][4]byte)
+
+	var curIP net.IP
+	var curMAC net.HardwareAddr
+	active := false
+
+	flush := func() {
+		if curMAC != nil {
+			var mac6 [6]byte
+			copy(mac6[:], curMAC[:6])
+			if active && curIP != nil {
+				var ip4 [4]byte
+				copy(ip4[:], curIP.To4())
+				entries[mac6] = ip4
+			} else {
+				delete(entries, mac6)
+			}
+		}
+		curIP, curMAC, active = nil, nil, false
+	}
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "lease "):
+			flush()
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				curIP = net.ParseIP(fields[1])
+			}
+		case strings.HasPrefix(line, "hardware ethernet"):
+			fields := strings.Fields(strings.TrimSuffix(line, ";"))
+			if len(fields) >= 3 {
+				if mac, err := net.ParseMAC(fields[2]); err == nil {
+					curMAC = mac
+				}
+			}
+		case strings.HasPrefix(line, "binding state active"):
+			active = true
+		case line == "}":
+			flush()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s: %w", path, err)
+	}
+
+	return &Leases{entries: entries}, nil
+}
+
+func (l *Leases) Lookup(mac [6]byte) ([4]byte, BootInfo, bool) {
+	ip, ok := l.entries[mac]
+	return ip, BootInfo{}, ok
+}
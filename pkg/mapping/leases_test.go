@@ -0,0 +1,37 @@
+package mapping
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewLeases(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dhcpd.leases")
+	content := `lease 192.168.1.50 {
+  starts 4 2024/01/01 00:00:00;
+  ends 4 2024/01/01 12:00:00;
+  hardware ethernet 52:54:00:12:34:56;
+  binding state active;
+}
+lease 192.168.1.50 {
+  starts 4 2024/01/02 00:00:00;
+  hardware ethernet 52:54:00:12:34:56;
+  binding state free;
+}
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	l, err := NewLeases(path)
+	if err != nil {
+		t.Fatalf("NewLeases: %v", err)
+	}
+
+	mac := [6]byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	if _, _, ok := l.Lookup(mac); ok {
+		t.Errorf("expected no binding since the latest lease is not active")
+	}
+}
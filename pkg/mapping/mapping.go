@@ -0,0 +1,29 @@
+// Package mapping provides pluggable sources for resolving a client's MAC
+// address to the IPv4 address (and optional BOOTP/DHCP boot parameters)
+// to hand it. Real RARP/BOOTP deployments need this to change without a
+// restart - a new client shows up, an existing one moves - so the server
+// consults the active Source on every request instead of a fixed map
+// built once at startup.
+package mapping
+
+// BootInfo carries the BOOTP/DHCP boot parameters associated with a host:
+// next-server, boot filename, root path (option 17), subnet mask
+// (option 1) and gateway (option 3). All fields are optional; zero values
+// mean "not set". BOOTP replies omit an unset boot filename, root path or
+// gateway, and fill an unset next-server with the server's own address
+// and an unset subnet mask with a default. Sources that
+// have no notion of boot parameters (e.g. Leases) always return the zero
+// value.
+type BootInfo struct {
+	NextServer [4]byte
+	Bootfile   string
+	RootPath   string
+	Netmask    [4]byte
+	Gateway    [4]byte
+}
+
+// Source resolves a MAC address to an IPv4 address and boot parameters.
+// ok is false when the source has no binding for mac.
+type Source interface {
+	Lookup(mac [6]byte) (ip [4]byte, extras BootInfo, ok bool)
+}
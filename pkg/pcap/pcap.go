@@ -0,0 +1,126 @@
+// Package pcap implements just enough of the classic libpcap file format
+// (global header + per-record header, as documented at
+// https://wiki.wireshark.org/Development/LibpcapFileFormat) to capture and
+// replay the Ethernet frames an install-server sees, without pulling in
+// gopacket or any other dependency.
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MagicLittleEndian is the classic (non-nanosecond) pcap magic number, as
+// it appears in the file when written little-endian.
+const MagicLittleEndian = 0xa1b2c3d4
+
+const (
+	versionMajor = 2
+	versionMinor = 4
+
+	globalHeaderLen = 24
+	recordHeaderLen = 16
+
+	// LinkTypeEthernet is LINKTYPE_ETHERNET (DLT_EN10MB); every frame this
+	// package reads or writes is a full Ethernet frame.
+	LinkTypeEthernet = 1
+)
+
+// Reader reads packets out of a pcap file. It detects the byte order from
+// the magic number, so it can read captures written on either endianness.
+type Reader struct {
+	r         io.Reader
+	byteOrder binary.ByteOrder
+	linkType  uint32
+}
+
+// NewReader reads and validates the pcap global header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	var hdr [globalHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("read global header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(hdr[0:4]) == MagicLittleEndian:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[0:4]) == MagicLittleEndian:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a pcap file: bad magic %#x", hdr[0:4])
+	}
+
+	return &Reader{
+		r:         r,
+		byteOrder: order,
+		linkType:  order.Uint32(hdr[20:24]),
+	}, nil
+}
+
+// LinkType returns the capture's LINKTYPE_* value (from the global header).
+func (r *Reader) LinkType() uint32 { return r.linkType }
+
+// ReadPacket reads the next record and returns its captured bytes and
+// timestamp. It returns io.EOF (unwrapped) once the file is exhausted.
+func (r *Reader) ReadPacket() ([]byte, time.Time, error) {
+	var rh [recordHeaderLen]byte
+	if _, err := io.ReadFull(r.r, rh[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, time.Time{}, fmt.Errorf("read record header: %w", err)
+		}
+		return nil, time.Time{}, err
+	}
+
+	sec := r.byteOrder.Uint32(rh[0:4])
+	usec := r.byteOrder.Uint32(rh[4:8])
+	inclLen := r.byteOrder.Uint32(rh[8:12])
+
+	data := make([]byte, inclLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, time.Time{}, fmt.Errorf("read packet data: %w", err)
+	}
+
+	return data, time.Unix(int64(sec), int64(usec)*1000), nil
+}
+
+// Writer writes packets to a pcap file (always little-endian, the
+// universal convention for pcap writers).
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the pcap global header to w for the given link type and
+// returns a Writer ready to accept packets.
+func NewWriter(w io.Writer, linkType uint32) (*Writer, error) {
+	var hdr [globalHeaderLen]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], MagicLittleEndian)
+	binary.LittleEndian.PutUint16(hdr[4:6], versionMajor)
+	binary.LittleEndian.PutUint16(hdr[6:8], versionMinor)
+	binary.LittleEndian.PutUint32(hdr[16:20], 65535) // snaplen
+	binary.LittleEndian.PutUint32(hdr[20:24], linkType)
+
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, fmt.Errorf("write global header: %w", err)
+	}
+	return &Writer{w: w}, nil
+}
+
+// WritePacket appends one record for data, captured at ts.
+func (w *Writer) WritePacket(data []byte, ts time.Time) error {
+	var rh [recordHeaderLen]byte
+	binary.LittleEndian.PutUint32(rh[0:4], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(rh[4:8], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rh[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(rh[12:16], uint32(len(data)))
+
+	if _, err := w.w.Write(rh[:]); err != nil {
+		return fmt.Errorf("write record header: %w", err)
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return fmt.Errorf("write packet data: %w", err)
+	}
+	return nil
+}
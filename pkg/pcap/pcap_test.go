@@ -0,0 +1,52 @@
+package pcap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, LinkTypeEthernet)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+
+	frames := [][]byte{
+		{0x01, 0x02, 0x03},
+		{0xaa, 0xbb, 0xcc, 0xdd},
+	}
+	ts := time.Unix(1700000000, 123000)
+	for _, f := range frames {
+		if err := w.WritePacket(f, ts); err != nil {
+			t.Fatalf("WritePacket: %v", err)
+		}
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if r.LinkType() != LinkTypeEthernet {
+		t.Errorf("LinkType() = %d, want %d", r.LinkType(), LinkTypeEthernet)
+	}
+
+	for i, want := range frames {
+		got, gotTS, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("ReadPacket() %d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("packet %d = %x, want %x", i, got, want)
+		}
+		if !gotTS.Equal(ts) {
+			t.Errorf("packet %d timestamp = %v, want %v", i, gotTS, ts)
+		}
+	}
+
+	if _, _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("ReadPacket() at EOF = %v, want io.EOF", err)
+	}
+}
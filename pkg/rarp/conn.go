@@ -0,0 +1,137 @@
+// Package rarp provides a batching AF_PACKET transport for RARP frames.
+//
+// The naive approach - one unix.Read/unix.Sendto syscall per frame - is
+// fine for a handful of Sun clients booting at the same time, but on a
+// busy broadcast segment every RARP request from every unknown MAC still
+// wakes userspace once. Conn instead drains and replies to frames in
+// batches of BatchSize using recvmmsg(2)/sendmmsg(2), amortizing the
+// syscall cost across the whole batch.
+package rarp
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultBatchSize is used by NewConn when batchSize <= 0.
+const DefaultBatchSize = 32
+
+// mmsghdr mirrors the kernel's struct mmsghdr (linux/socket.h): a Msghdr
+// plus a trailing received/sent length. golang.org/x/sys/unix exposes the
+// Msghdr/Iovec types used by sendmsg(2)/recvmsg(2) but stops short of
+// wrapping recvmmsg(2)/sendmmsg(2) themselves, so we build the batch call
+// on top of them with a raw Syscall6.
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+	_   uint32 // kernel pads the struct to 8-byte alignment on 64-bit
+}
+
+// frameSize is large enough for a standard Ethernet MTU frame; RARP
+// frames are small and fixed-size (14+28 bytes) but we size the receive
+// buffers generously in case a filter lets a bigger frame through.
+const frameSize = 2048
+
+// Conn wraps an AF_PACKET/SOCK_RAW file descriptor (as returned by the
+// caller's socket setup, e.g. openRawSocket) with batched recv/send.
+type Conn struct {
+	fd        int
+	BatchSize int
+	bufs      [][]byte
+}
+
+// NewConn wraps fd, an already bound AF_PACKET socket, in a Conn that
+// reads/writes up to batchSize frames per syscall. Conn takes ownership
+// of fd; call Close to release it.
+func NewConn(fd int, batchSize int) *Conn {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	c := &Conn{fd: fd, BatchSize: batchSize}
+	c.bufs = make([][]byte, batchSize)
+	for i := range c.bufs {
+		c.bufs[i] = make([]byte, frameSize)
+	}
+	return c
+}
+
+// recvmmsgOnce issues one recvmmsg(2) call against msgs[:vlen] and returns
+// the number of messages filled in.
+func recvmmsgOnce(fd int, msgs []mmsghdr, flags uintptr) (int, error) {
+	n, _, errno := unix.Syscall6(unix.SYS_RECVMMSG, uintptr(fd),
+		uintptr(unsafe.Pointer(&msgs[0])), uintptr(len(msgs)), flags, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// ReceiveBatch blocks until at least one frame is available and returns
+// it along with whatever else is already queued. Each returned slice
+// aliases the Conn's internal buffers and is only valid until the next
+// call to ReceiveBatch - callers that need to hold onto a frame past
+// that point must copy it.
+func (c *Conn) ReceiveBatch() ([][]byte, error) {
+	msgs := make([]mmsghdr, c.BatchSize)
+	iovecs := make([]unix.Iovec, c.BatchSize)
+	for i := range msgs {
+		iovecs[i].Base = &c.bufs[i][0]
+		iovecs[i].SetLen(len(c.bufs[i]))
+		msgs[i].hdr.Iov = &iovecs[i]
+		msgs[i].hdr.SetIovlen(1)
+	}
+
+	// Block for the first frame, then drain whatever else is already
+	// queued with a second, non-blocking call instead of waiting for the
+	// whole batch to fill (recvmmsg without MSG_WAITFORONE blocks on
+	// every slot up to BatchSize, not just the first).
+	n, err := recvmmsgOnce(c.fd, msgs[:1], 0)
+	if err != nil {
+		return nil, fmt.Errorf("recvmmsg: %w", err)
+	}
+	if n == 1 && c.BatchSize > 1 {
+		more, err := recvmmsgOnce(c.fd, msgs[1:], unix.MSG_DONTWAIT)
+		switch err {
+		case nil:
+			n += more
+		case unix.EAGAIN:
+			// nothing else queued right now
+		default:
+			return nil, fmt.Errorf("recvmmsg: %w", err)
+		}
+	}
+
+	out := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		out[i] = c.bufs[i][:msgs[i].len]
+	}
+	return out, nil
+}
+
+// SendBatch flushes frames in a single sendmmsg(2) call and returns the
+// number that were successfully queued for transmission.
+func (c *Conn) SendBatch(frames [][]byte) (int, error) {
+	if len(frames) == 0 {
+		return 0, nil
+	}
+	msgs := make([]mmsghdr, len(frames))
+	iovecs := make([]unix.Iovec, len(frames))
+	for i, f := range frames {
+		iovecs[i].Base = &f[0]
+		iovecs[i].SetLen(len(f))
+		msgs[i].hdr.Iov = &iovecs[i]
+		msgs[i].hdr.SetIovlen(1)
+	}
+
+	n, _, errno := unix.Syscall6(unix.SYS_SENDMMSG, uintptr(c.fd),
+		uintptr(unsafe.Pointer(&msgs[0])), uintptr(len(msgs)), 0, 0, 0)
+	if errno != 0 {
+		return int(n), fmt.Errorf("sendmmsg: %w", errno)
+	}
+	return int(n), nil
+}
+
+// Close releases the underlying file descriptor.
+func (c *Conn) Close() error { return unix.Close(c.fd) }
@@ -0,0 +1,104 @@
+package rarp
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// newLoopbackConn returns a pair of connected AF_UNIX/SOCK_DGRAM sockets
+// wrapped in Conns, standing in for a pair of AF_PACKET sockets so the
+// batching logic can be exercised without a real NIC or root.
+func newLoopbackConn(tb testing.TB, batchSize int) (*Conn, *Conn) {
+	tb.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		tb.Fatalf("socketpair: %v", err)
+	}
+	return NewConn(fds[0], batchSize), NewConn(fds[1], batchSize)
+}
+
+func TestSendReceiveBatch(t *testing.T) {
+	a, b := newLoopbackConn(t, 8)
+	defer a.Close()
+	defer b.Close()
+
+	frames := make([][]byte, 4)
+	for i := range frames {
+		frames[i] = []byte{byte(i), 1, 2, 3}
+	}
+
+	if _, err := a.SendBatch(frames); err != nil {
+		t.Fatalf("SendBatch: %v", err)
+	}
+
+	got, err := b.ReceiveBatch()
+	if err != nil {
+		t.Fatalf("ReceiveBatch: %v", err)
+	}
+	if len(got) != len(frames) {
+		t.Fatalf("got %d frames, want %d", len(got), len(frames))
+	}
+	for i, f := range got {
+		if len(f) != len(frames[i]) {
+			t.Errorf("frame %d: got length %d, want %d", i, len(f), len(frames[i]))
+		}
+		if f[0] != byte(i) {
+			t.Errorf("frame %d: got first byte %d, want %d", i, f[0], i)
+		}
+	}
+}
+
+func BenchmarkServe(b *testing.B) {
+	tx, rx := newLoopbackConn(b, 32)
+	defer tx.Close()
+	defer rx.Close()
+
+	frames := make([][]byte, 32)
+	for i := range frames {
+		frames[i] = make([]byte, 42)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tx.SendBatch(frames); err != nil {
+			b.Fatalf("SendBatch: %v", err)
+		}
+		if _, err := rx.ReceiveBatch(); err != nil {
+			b.Fatalf("ReceiveBatch: %v", err)
+		}
+	}
+}
+
+// BenchmarkServeNaive is the baseline BenchmarkServe is meant to improve
+// on: the same 32 frames per round, but one unix.Send/unix.Read syscall
+// per frame instead of one recvmmsg(2)/sendmmsg(2) call per batch.
+func BenchmarkServeNaive(b *testing.B) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		b.Fatalf("socketpair: %v", err)
+	}
+	tx, rx := fds[0], fds[1]
+	defer unix.Close(tx)
+	defer unix.Close(rx)
+
+	frames := make([][]byte, 32)
+	for i := range frames {
+		frames[i] = make([]byte, 42)
+	}
+	buf := make([]byte, frameSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range frames {
+			if err := unix.Send(tx, f, 0); err != nil {
+				b.Fatalf("send: %v", err)
+			}
+		}
+		for range frames {
+			if _, err := unix.Read(rx, buf); err != nil {
+				b.Fatalf("read: %v", err)
+			}
+		}
+	}
+}